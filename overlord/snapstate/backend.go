@@ -0,0 +1,156 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"github.com/ubuntu-core/snappy/progress"
+	"github.com/ubuntu-core/snappy/snap"
+	"github.com/ubuntu-core/snappy/snappy"
+)
+
+// backendIF is the interface the snap manager uses to talk to the
+// lower-level snappy backend. It exists so that tests can substitute a
+// fake implementation without touching the filesystem.
+//
+// Install/update is broken down into the narrow steps below (rather than
+// one opaque Install call) so that each one can be an individually
+// undoable task, with its own progress reporting.
+type backendIF interface {
+	// SnapInfo fetches the metadata of a snap on a channel without
+	// downloading it, so that the validate-snap task can run its
+	// preconditions before spending time and bandwidth on a download.
+	SnapInfo(name, channel string) (*snap.Info, error)
+
+	// Download fetches (or, for local installs, prepares) the snap and
+	// returns its SideInfo together with the path to the snap file.
+	Download(name, channel string, flags snappy.InstallFlags, meter progress.Meter) (*snap.SideInfo, string, error)
+	RemoveSnapDownload(snapPath string) error
+
+	// SetupMount makes the squashfs at snapPath available under the
+	// snap's revisioned install directory.
+	SetupMount(si *snap.SideInfo, snapPath string, meter progress.Meter) error
+	UndoSetupMount(si *snap.SideInfo, meter progress.Meter) error
+
+	// CopyData copies forward the data of the previous active revision,
+	// if any, into the new revision's data directory.
+	CopyData(si *snap.SideInfo, meter progress.Meter) error
+	UndoCopyData(si *snap.SideInfo, meter progress.Meter) error
+
+	// SetupSecurity generates the apparmor/seccomp profiles for the snap.
+	SetupSecurity(si *snap.SideInfo, meter progress.Meter) error
+	UndoSetupSecurity(si *snap.SideInfo, meter progress.Meter) error
+
+	// LinkSnap flips the "current" symlink to the new revision.
+	LinkSnap(si *snap.SideInfo, meter progress.Meter) error
+	UndoLinkSnap(si, oldSi *snap.SideInfo, meter progress.Meter) error
+
+	StartServices(si *snap.SideInfo, meter progress.Meter) error
+	StopServices(si *snap.SideInfo, meter progress.Meter) error
+
+	// TryPath bind-mounts the unpacked snap tree at path as name's
+	// current revision, for "snap try" development workflows.
+	TryPath(name, path string, flags snappy.InstallFlags, meter progress.Meter) (*snap.SideInfo, error)
+	UndoTryPath(name string, meter progress.Meter) error
+
+	Remove(name string, flags snappy.RemoveFlags, meter progress.Meter) error
+	Purge(name string, flags snappy.PurgeFlags, meter progress.Meter) error
+	Rollback(name, version string, meter progress.Meter) (string, error)
+	SetActive(name string, active bool, meter progress.Meter) error
+}
+
+// defaultBackend is the production backendIF implementation, delegating
+// to the snappy package.
+type defaultBackend struct{}
+
+func (b *defaultBackend) SnapInfo(name, channel string) (*snap.Info, error) {
+	return snappy.SnapInfo(name, channel)
+}
+
+func (b *defaultBackend) Download(name, channel string, flags snappy.InstallFlags, meter progress.Meter) (*snap.SideInfo, string, error) {
+	return snappy.Download(name, channel, flags, meter)
+}
+
+func (b *defaultBackend) RemoveSnapDownload(snapPath string) error {
+	return snappy.RemoveSnapFile(snapPath)
+}
+
+func (b *defaultBackend) SetupMount(si *snap.SideInfo, snapPath string, meter progress.Meter) error {
+	return snappy.SetupMount(si, snapPath, meter)
+}
+
+func (b *defaultBackend) UndoSetupMount(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.UndoSetupMount(si, meter)
+}
+
+func (b *defaultBackend) CopyData(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.CopyData(si, meter)
+}
+
+func (b *defaultBackend) UndoCopyData(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.UndoCopyData(si, meter)
+}
+
+func (b *defaultBackend) SetupSecurity(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.SetupSecurity(si, meter)
+}
+
+func (b *defaultBackend) UndoSetupSecurity(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.UndoSetupSecurity(si, meter)
+}
+
+func (b *defaultBackend) LinkSnap(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.LinkSnap(si, meter)
+}
+
+func (b *defaultBackend) UndoLinkSnap(si, oldSi *snap.SideInfo, meter progress.Meter) error {
+	return snappy.UndoLinkSnap(si, oldSi, meter)
+}
+
+func (b *defaultBackend) StartServices(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.StartServices(si, meter)
+}
+
+func (b *defaultBackend) StopServices(si *snap.SideInfo, meter progress.Meter) error {
+	return snappy.StopServices(si, meter)
+}
+
+func (b *defaultBackend) TryPath(name, path string, flags snappy.InstallFlags, meter progress.Meter) (*snap.SideInfo, error) {
+	return snappy.TryPath(name, path, flags, meter)
+}
+
+func (b *defaultBackend) UndoTryPath(name string, meter progress.Meter) error {
+	return snappy.UndoTryPath(name, meter)
+}
+
+func (b *defaultBackend) Remove(name string, flags snappy.RemoveFlags, meter progress.Meter) error {
+	return snappy.Remove(name, flags, meter)
+}
+
+func (b *defaultBackend) Purge(name string, flags snappy.PurgeFlags, meter progress.Meter) error {
+	return snappy.Purge(name, flags, meter)
+}
+
+func (b *defaultBackend) Rollback(name, version string, meter progress.Meter) (string, error) {
+	return snappy.Rollback(name, version, meter)
+}
+
+func (b *defaultBackend) SetActive(name string, active bool, meter progress.Meter) error {
+	return snappy.SetActive(name, active, meter)
+}
@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"github.com/ubuntu-core/snappy/progress"
+	"github.com/ubuntu-core/snappy/snap"
+	"github.com/ubuntu-core/snappy/snappy"
+)
+
+// fakeBackend is a no-op backendIF used by the tests in this package so
+// that they can drive the manager's task handlers without touching the
+// filesystem. snapInfo, when set, is returned by SnapInfo instead of a
+// zero-value *snap.Info. removedSnapPath and removedName record the
+// arguments of the last RemoveSnapDownload/Remove call so tests can assert
+// on them.
+type fakeBackend struct {
+	snapInfo *snap.Info
+
+	removedSnapPath string
+	removedName     string
+}
+
+func (f *fakeBackend) SnapInfo(name, channel string) (*snap.Info, error) {
+	if f.snapInfo != nil {
+		return f.snapInfo, nil
+	}
+	return &snap.Info{}, nil
+}
+
+func (f *fakeBackend) Download(name, channel string, flags snappy.InstallFlags, meter progress.Meter) (*snap.SideInfo, string, error) {
+	return &snap.SideInfo{OfficialName: name}, "/tmp/" + name + ".snap", nil
+}
+
+func (f *fakeBackend) RemoveSnapDownload(snapPath string) error {
+	f.removedSnapPath = snapPath
+	return nil
+}
+
+func (f *fakeBackend) SetupMount(si *snap.SideInfo, snapPath string, meter progress.Meter) error {
+	return nil
+}
+
+func (f *fakeBackend) UndoSetupMount(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) CopyData(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) UndoCopyData(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) SetupSecurity(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) UndoSetupSecurity(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) LinkSnap(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) UndoLinkSnap(si, oldSi *snap.SideInfo, meter progress.Meter) error {
+	return nil
+}
+
+func (f *fakeBackend) StartServices(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) StopServices(si *snap.SideInfo, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) TryPath(name, path string, flags snappy.InstallFlags, meter progress.Meter) (*snap.SideInfo, error) {
+	return &snap.SideInfo{OfficialName: name}, nil
+}
+
+func (f *fakeBackend) UndoTryPath(name string, meter progress.Meter) error { return nil }
+
+func (f *fakeBackend) Remove(name string, flags snappy.RemoveFlags, meter progress.Meter) error {
+	f.removedName = name
+	return nil
+}
+
+func (f *fakeBackend) Purge(name string, flags snappy.PurgeFlags, meter progress.Meter) error {
+	return nil
+}
+
+func (f *fakeBackend) Rollback(name, version string, meter progress.Meter) (string, error) {
+	return version, nil
+}
+
+func (f *fakeBackend) SetActive(name string, active bool, meter progress.Meter) error { return nil }
@@ -0,0 +1,56 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"testing"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+)
+
+// TestDownloadSnapAndUndo exercises the rollback of a partial install that
+// failed right after download-snap: undoDownloadSnap must remove the file
+// doDownloadSnap itself just fetched, not the validate task's SnapSetup
+// (which never had SnapPath set).
+func TestDownloadSnapAndUndo(t *testing.T) {
+	st := state.New(nil)
+	backend := &fakeBackend{}
+	m := &SnapManager{backend: backend}
+
+	st.Lock()
+	validate := st.NewTask("validate-snap", "Validate foo snap")
+	validate.Set("snap-setup", &SnapSetup{Name: "foo", Channel: "stable"})
+
+	download := st.NewTask("download-snap", "Download foo snap")
+	download.Set("snap-setup-task", validate.ID())
+	st.Unlock()
+
+	if err := m.doDownloadSnap(download, nil); err != nil {
+		t.Fatalf("doDownloadSnap failed: %v", err)
+	}
+
+	if err := m.undoDownloadSnap(download, nil); err != nil {
+		t.Fatalf("undoDownloadSnap failed: %v", err)
+	}
+
+	if want := "/tmp/foo.snap"; backend.removedSnapPath != want {
+		t.Fatalf("undoDownloadSnap removed %q, want %q", backend.removedSnapPath, want)
+	}
+}
@@ -0,0 +1,135 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+)
+
+// ErrSnapNotInstalled is returned when an operation is attempted against
+// a snap that has no SnapState on record.
+type ErrSnapNotInstalled struct {
+	Name string
+}
+
+func (e ErrSnapNotInstalled) Error() string {
+	return fmt.Sprintf("snap %q is not installed", e.Name)
+}
+
+// Kind identifies the error for clients that want to react to it
+// programmatically instead of matching on the message.
+func (e ErrSnapNotInstalled) Kind() string { return "snap-not-installed" }
+
+// ErrSnapAlreadyInstalled is returned when Install is attempted against a
+// snap that already has a current revision.
+type ErrSnapAlreadyInstalled struct {
+	Name     string
+	Revision string
+}
+
+func (e ErrSnapAlreadyInstalled) Error() string {
+	return fmt.Sprintf("snap %q already installed (revision %s)", e.Name, e.Revision)
+}
+
+func (e ErrSnapAlreadyInstalled) Kind() string { return "snap-already-installed" }
+
+// ErrNoRollbackTarget is returned when a rollback is requested for a snap
+// that has no earlier revision in its Sequence to roll back to.
+type ErrNoRollbackTarget struct {
+	Name string
+}
+
+func (e ErrNoRollbackTarget) Error() string {
+	return fmt.Sprintf("no rollback state for %q available", e.Name)
+}
+
+func (e ErrNoRollbackTarget) Kind() string { return "no-rollback-target" }
+
+// ErrDownloadFailed wraps a download failure with the snap name and the
+// source it was being fetched from, alongside the underlying error. When
+// no URL is known, as in doDownloadSnap, URL holds "channel:<channel>".
+type ErrDownloadFailed struct {
+	Name string
+	URL  string
+	Err  error
+}
+
+func (e ErrDownloadFailed) Error() string {
+	return fmt.Sprintf("cannot download %q from %q: %v", e.Name, e.URL, e.Err)
+}
+
+func (e ErrDownloadFailed) Kind() string { return "download-failed" }
+
+// ErrArchitectureNotSupported is returned when a snap's declared
+// architecture does not match any of the architectures this system
+// supports.
+type ErrArchitectureNotSupported struct {
+	Got  string
+	Want []string
+}
+
+func (e ErrArchitectureNotSupported) Error() string {
+	return fmt.Sprintf("snap architecture %q is not supported by this system (%v)", e.Got, e.Want)
+}
+
+func (e ErrArchitectureNotSupported) Kind() string { return "architecture-not-supported" }
+
+// kindedErr is implemented by every typed error above, so that callers
+// can ask an error for its machine-readable kind without a type switch.
+type kindedErr interface {
+	error
+	Kind() string
+}
+
+// errJSON is the structured form a kindedErr is logged as, so the REST
+// API layer can surface err.Kind() to clients (the snap CLI, GNOME
+// Software, ...) as a machine-readable error kind rather than a
+// free-form message.
+type errJSON struct {
+	Kind    string `json:"kind,omitempty"`
+	Message string `json:"message"`
+}
+
+// logTaskError appends err to t's log, serialized as JSON; when err is a
+// kindedErr its kind is included, so that it can later be decoded back
+// into a structured error kind by the daemon. It returns err unchanged,
+// so it can be used as `return logTaskError(t, err)`.
+func logTaskError(t *state.Task, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	ej := errJSON{Message: err.Error()}
+	if ke, ok := err.(kindedErr); ok {
+		ej.Kind = ke.Kind()
+	}
+
+	data, jsonErr := json.Marshal(ej)
+	if jsonErr != nil {
+		t.Errorf("%v", err)
+		return err
+	}
+	t.Errorf("%s", data)
+
+	return err
+}
@@ -0,0 +1,148 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/snap"
+	"github.com/ubuntu-core/snappy/snappy"
+)
+
+// SnapSetup holds the information passed between the tasks of an
+// install/update TaskSet as a snap moves from downloaded file to linked,
+// running revision.
+type SnapSetup struct {
+	Name    string              `json:"name"`
+	Channel string              `json:"channel,omitempty"`
+	Flags   snappy.InstallFlags `json:"flags,omitempty"`
+
+	// SnapType is filled in by the validate-snap task, once the snap's
+	// metadata has been fetched, for the later tasks to record in
+	// SnapState without having to re-fetch it.
+	SnapType string `json:"type,omitempty"`
+
+	SnapPath string         `json:"snap-path,omitempty"`
+	SideInfo *snap.SideInfo `json:"side-info,omitempty"`
+}
+
+// Install returns a set of tasks for installing a snap.
+// Note that the state must be locked by the caller.
+func Install(s *state.State, name, channel string, flags snappy.InstallFlags) (*state.TaskSet, error) {
+	var snapst SnapState
+	err := Get(s, name, &snapst)
+	if err != nil && err != ErrNoState {
+		return nil, err
+	}
+	if cur := snapst.Current(); cur != nil {
+		return nil, ErrSnapAlreadyInstalled{Name: name, Revision: cur.Revision.String()}
+	}
+
+	return doInstall(s, &SnapSetup{Name: name, Channel: channel, Flags: flags})
+}
+
+// Update returns a set of tasks for updating a snap to a new revision.
+// Note that the state must be locked by the caller.
+func Update(s *state.State, name, channel string, flags snappy.InstallFlags) (*state.TaskSet, error) {
+	var snapst SnapState
+	if err := Get(s, name, &snapst); err != nil {
+		return nil, err
+	}
+	if snapst.Current() == nil {
+		return nil, ErrSnapNotInstalled{Name: name}
+	}
+	if snapst.TryMode {
+		return nil, fmt.Errorf("cannot refresh %q: snap is in try mode, unmount it with \"snap remove\" first", name)
+	}
+
+	return doInstall(s, &SnapSetup{Name: name, Channel: channel, Flags: flags})
+}
+
+// doInstall builds the validate -> download -> mount -> copy-data ->
+// setup-security -> link -> start-services chain shared by Install and
+// Update.
+func doInstall(s *state.State, snapsup *SnapSetup) (*state.TaskSet, error) {
+	validate := s.NewTask("validate-snap", fmt.Sprintf("Validate %q snap", snapsup.Name))
+	validate.Set("snap-setup", snapsup)
+
+	download := s.NewTask("download-snap", fmt.Sprintf("Download %q snap", snapsup.Name))
+	download.Set("snap-setup-task", validate.ID())
+	download.WaitFor(validate)
+
+	mount := s.NewTask("mount-snap", fmt.Sprintf("Mount %q snap", snapsup.Name))
+	mount.Set("snap-setup-task", download.ID())
+	mount.WaitFor(download)
+
+	copyData := s.NewTask("copy-snap-data", fmt.Sprintf("Copy snap %q data", snapsup.Name))
+	copyData.Set("snap-setup-task", download.ID())
+	copyData.WaitFor(mount)
+
+	setupSecurity := s.NewTask("setup-snap-security", fmt.Sprintf("Setup snap %q security profiles", snapsup.Name))
+	setupSecurity.Set("snap-setup-task", download.ID())
+	setupSecurity.WaitFor(copyData)
+
+	link := s.NewTask("link-snap", fmt.Sprintf("Make snap %q available to the system", snapsup.Name))
+	link.Set("snap-setup-task", download.ID())
+	link.WaitFor(setupSecurity)
+
+	startServices := s.NewTask("start-snap-services", fmt.Sprintf("Start snap %q services", snapsup.Name))
+	startServices.Set("snap-setup-task", download.ID())
+	startServices.WaitFor(link)
+
+	return state.NewTaskSet(validate, download, mount, copyData, setupSecurity, link, startServices), nil
+}
+
+// sameRevision reports whether a and b refer to the same revision of the
+// same snap. SideInfo values coming out of the state are always freshly
+// unmarshalled, so they must be compared by value rather than by
+// pointer identity.
+func sameRevision(a, b *snap.SideInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.OfficialName == b.OfficialName && a.Revision == b.Revision
+}
+
+// snapSetupForTask fetches the SnapSetup shared by every task of an
+// install/update TaskSet. A task that stores its own SnapSetup (validate,
+// and download once it has recorded the fetched SideInfo/SnapPath) is
+// authoritative for itself; every other task follows the "snap-setup-task"
+// pointer back to the task that owns the shared copy.
+func snapSetupForTask(t *state.Task) (*SnapSetup, error) {
+	var snapsup SnapSetup
+	if err := t.Get("snap-setup", &snapsup); err == nil {
+		return &snapsup, nil
+	}
+
+	var id string
+	if err := t.Get("snap-setup-task", &id); err != nil {
+		return nil, err
+	}
+
+	ts := t.State().Task(id)
+	if ts == nil {
+		return nil, fmt.Errorf("internal error: tasks are being pruned")
+	}
+	if err := ts.Get("snap-setup", &snapsup); err != nil {
+		return nil, err
+	}
+	return &snapsup, nil
+}
@@ -0,0 +1,71 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"testing"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/snap"
+)
+
+// TestLinkSnapAndUndo exercises the Sequence bookkeeping done by
+// doLinkSnap/undoLinkSnap: link-snap must append the new revision, and
+// undoing it (as happens when a later task in the install chain fails)
+// must remove exactly that revision again.
+func TestLinkSnapAndUndo(t *testing.T) {
+	st := state.New(nil)
+	m := &SnapManager{backend: &fakeBackend{}}
+
+	st.Lock()
+	task := st.NewTask("link-snap", "Make snap available to the system")
+	si := &snap.SideInfo{OfficialName: "foo", Revision: snap.R(1)}
+	task.Set("snap-setup", &SnapSetup{Name: "foo", Channel: "stable", SideInfo: si})
+	st.Unlock()
+
+	if err := m.doLinkSnap(task, nil); err != nil {
+		t.Fatalf("doLinkSnap failed: %v", err)
+	}
+
+	st.Lock()
+	var snapst SnapState
+	err := Get(st, "foo", &snapst)
+	st.Unlock()
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(snapst.Sequence) != 1 || !snapst.Active {
+		t.Fatalf("unexpected state after link-snap: %#v", snapst)
+	}
+
+	if err := m.undoLinkSnap(task, nil); err != nil {
+		t.Fatalf("undoLinkSnap failed: %v", err)
+	}
+
+	st.Lock()
+	err = Get(st, "foo", &snapst)
+	st.Unlock()
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(snapst.Sequence) != 0 || snapst.Active {
+		t.Fatalf("undoLinkSnap did not remove the appended revision: %#v", snapst)
+	}
+}
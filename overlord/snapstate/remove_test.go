@@ -0,0 +1,64 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"testing"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/snap"
+)
+
+// TestRemoveSnapClearsWholeSequence covers a snap with refresh history: a
+// full removal must wipe every recorded revision, not just the last one,
+// so a later Install for the same name isn't rejected as already
+// installed.
+func TestRemoveSnapClearsWholeSequence(t *testing.T) {
+	st := state.New(nil)
+	m := &SnapManager{backend: &fakeBackend{}}
+
+	st.Lock()
+	Set(st, "foo", &SnapState{
+		Sequence: []*snap.SideInfo{
+			{OfficialName: "foo", Revision: snap.R(1)},
+			{OfficialName: "foo", Revision: snap.R(2)},
+		},
+		Active: true,
+	})
+
+	task := st.NewTask("remove-snap", "Remove foo snap")
+	task.Set("state", &removeState{Name: "foo"})
+	st.Unlock()
+
+	if err := m.doRemoveSnap(task, nil); err != nil {
+		t.Fatalf("doRemoveSnap failed: %v", err)
+	}
+
+	st.Lock()
+	var snapst SnapState
+	err := Get(st, "foo", &snapst)
+	st.Unlock()
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(snapst.Sequence) != 0 || snapst.Active {
+		t.Fatalf("doRemoveSnap left stale state behind: %#v", snapst)
+	}
+}
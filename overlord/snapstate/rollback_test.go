@@ -0,0 +1,45 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"testing"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+)
+
+// TestRollbackSnapNotInstalled makes sure a rollback of a snap with no
+// recorded SnapState surfaces as the typed ErrSnapNotInstalled, the same
+// way doRemoveSnap and doPurgeSnap already do, instead of the raw
+// ErrNoState leaking out of the state package.
+func TestRollbackSnapNotInstalled(t *testing.T) {
+	st := state.New(nil)
+	m := &SnapManager{backend: &fakeBackend{}}
+
+	st.Lock()
+	task := st.NewTask("rollback-snap", "Rollback foo snap")
+	task.Set("state", &rollbackState{Name: "foo", Version: "1"})
+	st.Unlock()
+
+	err := m.doRollbackSnap(task, nil)
+	if _, ok := err.(ErrSnapNotInstalled); !ok {
+		t.Fatalf("expected ErrSnapNotInstalled, got %#v", err)
+	}
+}
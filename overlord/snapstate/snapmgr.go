@@ -21,12 +21,14 @@
 package snapstate
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"gopkg.in/tomb.v2"
 
 	"github.com/ubuntu-core/snappy/overlord/state"
 	"github.com/ubuntu-core/snappy/progress"
+	"github.com/ubuntu-core/snappy/snap"
 	"github.com/ubuntu-core/snappy/snappy"
 )
 
@@ -38,12 +40,6 @@ type SnapManager struct {
 	runner *state.TaskRunner
 }
 
-type installState struct {
-	Name    string              `json:"name"`
-	Channel string              `json:"channel"`
-	Flags   snappy.InstallFlags `json:"flags,omitempty"`
-}
-
 type removeState struct {
 	Name  string             `json:"name"`
 	Flags snappy.RemoveFlags `json:"flags,omitempty"`
@@ -74,8 +70,27 @@ func Manager(s *state.State) (*SnapManager, error) {
 		runner:  runner,
 	}
 
-	runner.AddHandler("install-snap", m.doInstallSnap)
-	runner.AddHandler("update-snap", m.doUpdateSnap)
+	s.Lock()
+	var seeded bool
+	_ = s.Get("snaps-seeded", &seeded)
+	s.Unlock()
+	if !seeded {
+		if err := populateStateFromInstalled(s); err != nil {
+			return nil, err
+		}
+		s.Lock()
+		s.Set("snaps-seeded", true)
+		s.Unlock()
+	}
+
+	runner.AddHandler("validate-snap", m.doValidateSnap)
+	runner.AddHandler("download-snap", m.doDownloadSnap, m.undoDownloadSnap)
+	runner.AddHandler("mount-snap", m.doMountSnap, m.undoMountSnap)
+	runner.AddHandler("copy-snap-data", m.doCopySnapData, m.undoCopySnapData)
+	runner.AddHandler("setup-snap-security", m.doSetupSnapSecurity, m.undoSetupSnapSecurity)
+	runner.AddHandler("link-snap", m.doLinkSnap, m.undoLinkSnap)
+	runner.AddHandler("start-snap-services", m.doStartSnapServices, m.undoStartSnapServices)
+	runner.AddHandler("try-snap", m.doTrySnap, m.undoTrySnap)
 	runner.AddHandler("remove-snap", m.doRemoveSnap)
 	runner.AddHandler("purge-snap", m.doPurgeSnap)
 	runner.AddHandler("rollback-snap", m.doRollbackSnap)
@@ -92,28 +107,193 @@ func Manager(s *state.State) (*SnapManager, error) {
 	return m, nil
 }
 
-func (m *SnapManager) doInstallSnap(t *state.Task, _ *tomb.Tomb) error {
-	var inst installState
+func (m *SnapManager) doDownloadSnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	si, snapPath, err := m.backend.Download(snapsup.Name, snapsup.Channel, snapsup.Flags, &progress.NullProgress{})
+	if err != nil {
+		t.State().Lock()
+		defer t.State().Unlock()
+		return logTaskError(t, ErrDownloadFailed{Name: snapsup.Name, URL: fmt.Sprintf("channel:%s", snapsup.Channel), Err: err})
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	snapsup.SideInfo = si
+	snapsup.SnapPath = snapPath
+	t.Set("snap-setup", snapsup)
+
+	return nil
+}
+
+func (m *SnapManager) undoDownloadSnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.RemoveSnapDownload(snapsup.SnapPath)
+}
+
+func (m *SnapManager) doMountSnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.SetupMount(snapsup.SideInfo, snapsup.SnapPath, &progress.NullProgress{})
+}
+
+func (m *SnapManager) undoMountSnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.UndoSetupMount(snapsup.SideInfo, &progress.NullProgress{})
+}
+
+func (m *SnapManager) doCopySnapData(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.CopyData(snapsup.SideInfo, &progress.NullProgress{})
+}
+
+func (m *SnapManager) undoCopySnapData(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.UndoCopyData(snapsup.SideInfo, &progress.NullProgress{})
+}
+
+func (m *SnapManager) doSetupSnapSecurity(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.SetupSecurity(snapsup.SideInfo, &progress.NullProgress{})
+}
+
+func (m *SnapManager) undoSetupSnapSecurity(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.UndoSetupSecurity(snapsup.SideInfo, &progress.NullProgress{})
+}
+
+func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
+	if err != nil {
+		t.State().Unlock()
+		return err
+	}
+
+	var snapst SnapState
+	if err := Get(t.State(), snapsup.Name, &snapst); err != nil && err != ErrNoState {
+		t.State().Unlock()
+		return err
+	}
+	oldCurrent := snapst.Current()
+	t.Set("old-current", oldCurrent)
+	t.State().Unlock()
+
+	if err := m.backend.LinkSnap(snapsup.SideInfo, &progress.NullProgress{}); err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	snapst.Sequence = append(snapst.Sequence, snapsup.SideInfo)
+	snapst.Active = true
+	snapst.Channel = snapsup.Channel
+	snapst.Flags = snapsup.Flags
+	snapst.SnapType = snapsup.SnapType
+	Set(t.State(), snapsup.Name, &snapst)
+
+	return nil
+}
+
+func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	t.State().Lock()
-	if err := t.Get("state", &inst); err != nil {
+	snapsup, err := snapSetupForTask(t)
+	if err != nil {
+		t.State().Unlock()
 		return err
 	}
+	var oldCurrent *snap.SideInfo
+	_ = t.Get("old-current", &oldCurrent)
 	t.State().Unlock()
 
-	_, err := m.backend.Install(inst.Name, inst.Channel, inst.Flags, &progress.NullProgress{})
-	return err
+	if err := m.backend.UndoLinkSnap(snapsup.SideInfo, oldCurrent, &progress.NullProgress{}); err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	var snapst SnapState
+	if err := Get(t.State(), snapsup.Name, &snapst); err != nil && err != ErrNoState {
+		return err
+	}
+	if n := len(snapst.Sequence); n > 0 && sameRevision(snapst.Sequence[n-1], snapsup.SideInfo) {
+		snapst.Sequence = snapst.Sequence[:n-1]
+	}
+	snapst.Active = oldCurrent != nil
+	Set(t.State(), snapsup.Name, &snapst)
+
+	return nil
 }
 
-func (m *SnapManager) doUpdateSnap(t *state.Task, _ *tomb.Tomb) error {
-	var inst installState
+func (m *SnapManager) doStartSnapServices(t *state.Task, _ *tomb.Tomb) error {
 	t.State().Lock()
-	if err := t.Get("state", &inst); err != nil {
+	snapsup, err := snapSetupForTask(t)
+	t.State().Unlock()
+	if err != nil {
 		return err
 	}
+
+	return m.backend.StartServices(snapsup.SideInfo, &progress.NullProgress{})
+}
+
+func (m *SnapManager) undoStartSnapServices(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	snapsup, err := snapSetupForTask(t)
 	t.State().Unlock()
+	if err != nil {
+		return err
+	}
 
-	err := m.backend.Update(inst.Name, inst.Channel, inst.Flags, &progress.NullProgress{})
-	return err
+	return m.backend.StopServices(snapsup.SideInfo, &progress.NullProgress{})
 }
 
 func (m *SnapManager) doRemoveSnap(t *state.Task, _ *tomb.Tomb) error {
@@ -126,8 +306,40 @@ func (m *SnapManager) doRemoveSnap(t *state.Task, _ *tomb.Tomb) error {
 	t.State().Unlock()
 
 	name, _ := snappy.SplitDeveloper(rm.Name)
-	err := m.backend.Remove(name, rm.Flags, &progress.NullProgress{})
-	return err
+
+	t.State().Lock()
+	var snapst SnapState
+	err := Get(t.State(), name, &snapst)
+	if err == ErrNoState {
+		err = logTaskError(t, ErrSnapNotInstalled{Name: name})
+	}
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	if snapst.TryMode {
+		// a "snap try" snap isn't owned by snapd: unmount it rather
+		// than deleting the developer's source tree.
+		if err := m.backend.UndoTryPath(name, &progress.NullProgress{}); err != nil {
+			return err
+		}
+	} else if err := m.backend.Remove(name, rm.Flags, &progress.NullProgress{}); err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	// unlike doPurgeSnap, which only drops the state entry, backend.Remove
+	// (and UndoTryPath) above uninstalled every revision on disk, so the
+	// whole Sequence needs to go, not just its last entry.
+	snapst.Sequence = nil
+	snapst.Active = false
+	snapst.TryMode = false
+	Set(t.State(), name, &snapst)
+
+	return nil
 }
 
 func (m *SnapManager) doPurgeSnap(t *state.Task, _ *tomb.Tomb) error {
@@ -140,8 +352,37 @@ func (m *SnapManager) doPurgeSnap(t *state.Task, _ *tomb.Tomb) error {
 	t.State().Unlock()
 
 	name, _ := snappy.SplitDeveloper(purge.Name)
-	err := m.backend.Purge(name, purge.Flags, &progress.NullProgress{})
-	return err
+
+	t.State().Lock()
+	var snapst SnapState
+	err := Get(t.State(), name, &snapst)
+	if err == ErrNoState {
+		err = logTaskError(t, ErrSnapNotInstalled{Name: name})
+	}
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	if snapst.TryMode {
+		if err := m.backend.UndoTryPath(name, &progress.NullProgress{}); err != nil {
+			return err
+		}
+	} else if err := m.backend.Purge(name, purge.Flags, &progress.NullProgress{}); err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	var snaps map[string]*json.RawMessage
+	if err := t.State().Get("snaps", &snaps); err != nil {
+		return err
+	}
+	delete(snaps, name)
+	t.State().Set("snaps", snaps)
+
+	return nil
 }
 
 func (m *SnapManager) doRollbackSnap(t *state.Task, _ *tomb.Tomb) error {
@@ -154,8 +395,40 @@ func (m *SnapManager) doRollbackSnap(t *state.Task, _ *tomb.Tomb) error {
 	t.State().Unlock()
 
 	name, _ := snappy.SplitDeveloper(rollback.Name)
-	_, err := m.backend.Rollback(name, rollback.Version, &progress.NullProgress{})
-	return err
+	ver, err := m.backend.Rollback(name, rollback.Version, &progress.NullProgress{})
+	if err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	var snapst SnapState
+	err = Get(t.State(), name, &snapst)
+	if err == ErrNoState {
+		err = logTaskError(t, ErrSnapNotInstalled{Name: name})
+	}
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, si := range snapst.Sequence {
+		if si.Revision.String() == ver {
+			// move the rolled back to revision to the end of the
+			// sequence so it becomes the current one again
+			snapst.Sequence = append(snapst.Sequence[:i], snapst.Sequence[i+1:]...)
+			snapst.Sequence = append(snapst.Sequence, si)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return logTaskError(t, ErrNoRollbackTarget{Name: name})
+	}
+	Set(t.State(), name, &snapst)
+
+	return nil
 }
 
 func (m *SnapManager) doSetActiveSnap(t *state.Task, _ *tomb.Tomb) error {
@@ -168,7 +441,21 @@ func (m *SnapManager) doSetActiveSnap(t *state.Task, _ *tomb.Tomb) error {
 	t.State().Unlock()
 
 	name, _ := snappy.SplitDeveloper(setActive.Name)
-	return m.backend.SetActive(name, setActive.Active, &progress.NullProgress{})
+	if err := m.backend.SetActive(name, setActive.Active, &progress.NullProgress{}); err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	var snapst SnapState
+	if err := Get(t.State(), name, &snapst); err != nil {
+		return err
+	}
+	snapst.Active = setActive.Active
+	Set(t.State(), name, &snapst)
+
+	return nil
 }
 
 // Ensure implements StateManager.Ensure.
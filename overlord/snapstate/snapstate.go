@@ -0,0 +1,150 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/snap"
+	"github.com/ubuntu-core/snappy/snappy"
+)
+
+// SnapState holds the state for a snap installed in the system.
+//
+// It is the source of truth for which revisions of a snap are on disk
+// and which one of them is active, replacing ad-hoc probing of the
+// filesystem by consumers of the snappy package.
+type SnapState struct {
+	SnapType string              `json:"type,omitempty"`
+	Sequence []*snap.SideInfo    `json:"sequence"`
+	Active   bool                `json:"active"`
+	Channel  string              `json:"channel,omitempty"`
+	Flags    snappy.InstallFlags `json:"flags,omitempty"`
+
+	// TryMode is set for snaps installed with snapstate.TryPath: the
+	// current revision is bind-mounted from a local, unpacked snap
+	// tree rather than owned by snapd, so remove and purge unmount
+	// it instead of deleting it. Update refuses to refresh such a
+	// snap; it does not unmount it.
+	TryMode bool `json:"trymode,omitempty"`
+}
+
+// Current returns the SideInfo for the current revision, which is the
+// last one in the sequence (a rollback moves its target revision there),
+// or nil if the snap has no revisions on record.
+func (snapst *SnapState) Current() *snap.SideInfo {
+	n := len(snapst.Sequence)
+	if n == 0 {
+		return nil
+	}
+	return snapst.Sequence[n-1]
+}
+
+// ErrNoState is returned by Get when no state is associated with the given name.
+var ErrNoState = fmt.Errorf("no state entry for key")
+
+// Get retrieves the SnapState of the given snap.
+func Get(st *state.State, name string, snapst *SnapState) error {
+	if snapst == nil {
+		return fmt.Errorf("internal error: snapst is nil")
+	}
+
+	var snaps map[string]*json.RawMessage
+	if err := st.Get("snaps", &snaps); err != nil {
+		// no snap has ever been recorded yet, e.g. on a pristine system
+		return ErrNoState
+	}
+	raw, ok := snaps[name]
+	if !ok {
+		return ErrNoState
+	}
+	return json.Unmarshal([]byte(*raw), snapst)
+}
+
+// Set sets the SnapState of the given snap, overwriting any earlier state.
+func Set(st *state.State, name string, snapst *SnapState) {
+	var snaps map[string]*json.RawMessage
+	if err := st.Get("snaps", &snaps); err != nil {
+		snaps = make(map[string]*json.RawMessage)
+	}
+	data, err := json.Marshal(snapst)
+	if err != nil {
+		panic("internal error: cannot marshal snap state: " + err.Error())
+	}
+	raw := json.RawMessage(data)
+	snaps[name] = &raw
+	st.Set("snaps", snaps)
+}
+
+// All returns a SnapState for all current snaps in the state, keyed by name.
+func All(st *state.State) (map[string]*SnapState, error) {
+	var snaps map[string]*json.RawMessage
+	if err := st.Get("snaps", &snaps); err != nil {
+		// no snap has ever been recorded yet, e.g. on a pristine system
+		return nil, ErrNoState
+	}
+
+	curStates := make(map[string]*SnapState, len(snaps))
+	for name, raw := range snaps {
+		var snapst SnapState
+		if err := json.Unmarshal([]byte(*raw), &snapst); err != nil {
+			return nil, err
+		}
+		curStates[name] = &snapst
+	}
+	return curStates, nil
+}
+
+// populateStateFromInstalled seeds the state from the snaps already
+// installed on disk. It is meant to be run once, the first time snapd
+// starts up on a system whose state has no knowledge of installed snaps
+// yet, so that snapd itself becomes the source of truth going forward.
+func populateStateFromInstalled(st *state.State) error {
+	all, err := snappy.Overlord{}.Installed()
+	if err != nil {
+		return err
+	}
+
+	st.Lock()
+	defer st.Unlock()
+
+	for _, part := range all {
+		name := part.Name()
+
+		var snapst SnapState
+		if err := Get(st, name, &snapst); err != nil && err != ErrNoState {
+			return err
+		}
+
+		snapst.Sequence = append(snapst.Sequence, &snap.SideInfo{
+			OfficialName: name,
+			Revision:     part.Revision(),
+			Channel:      part.Channel(),
+		})
+		snapst.Active = part.IsActive()
+		snapst.Channel = part.Channel()
+
+		Set(st, name, &snapst)
+	}
+
+	return nil
+}
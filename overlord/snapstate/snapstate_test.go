@@ -0,0 +1,104 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"testing"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/snap"
+)
+
+func TestGetSetRoundtrip(t *testing.T) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	Set(st, "foo", &SnapState{
+		Sequence: []*snap.SideInfo{{OfficialName: "foo", Revision: snap.R(1)}},
+		Active:   true,
+		Channel:  "stable",
+	})
+
+	var snapst SnapState
+	if err := Get(st, "foo", &snapst); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !snapst.Active || snapst.Channel != "stable" || len(snapst.Sequence) != 1 {
+		t.Fatalf("unexpected state: %#v", snapst)
+	}
+}
+
+func TestGetOnPristineSystem(t *testing.T) {
+	// nothing has ever been Set, so the "snaps" key itself is missing,
+	// not just the "foo" entry inside it.
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var snapst SnapState
+	if err := Get(st, "foo", &snapst); err != ErrNoState {
+		t.Fatalf("expected ErrNoState on a pristine system, got %v", err)
+	}
+}
+
+func TestGetUnknownSnap(t *testing.T) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	Set(st, "foo", &SnapState{Active: true})
+
+	var snapst SnapState
+	if err := Get(st, "bar", &snapst); err != ErrNoState {
+		t.Fatalf("expected ErrNoState for an unknown snap, got %v", err)
+	}
+}
+
+func TestAllOnPristineSystem(t *testing.T) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	all, err := All(st)
+	if err != nil && err != ErrNoState {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 0 {
+		t.Fatalf("expected no snaps, got %#v", all)
+	}
+}
+
+func TestAll(t *testing.T) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	Set(st, "foo", &SnapState{Active: true})
+	Set(st, "bar", &SnapState{Active: false})
+
+	all, err := All(st)
+	if err != nil {
+		t.Fatalf("All failed: %v", err)
+	}
+	if len(all) != 2 || !all["foo"].Active || all["bar"].Active {
+		t.Fatalf("unexpected result: %#v", all)
+	}
+}
@@ -0,0 +1,95 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/progress"
+	"github.com/ubuntu-core/snappy/snappy"
+)
+
+// TryPath returns a set of tasks for trying a snap from an already
+// unpacked directory, such as one produced by "snap try" during
+// development. Unlike Install, the snap is bind-mounted from path rather
+// than unpacked from a .snap file, so the developer's source tree is
+// never touched by snapd.
+//
+// Note that the state must be locked by the caller.
+func TryPath(s *state.State, name, path string, flags snappy.InstallFlags) (*state.TaskSet, error) {
+	var snapst SnapState
+	if err := Get(s, name, &snapst); err != nil && err != ErrNoState {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("Try %q snap from %q", name, path)
+	t := s.NewTask("try-snap", summary)
+	t.Set("snap-setup", &SnapSetup{
+		Name:     name,
+		SnapPath: path,
+		Flags:    flags,
+	})
+
+	return state.NewTaskSet(t), nil
+}
+
+func (m *SnapManager) doTrySnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	var snapsup SnapSetup
+	err := t.Get("snap-setup", &snapsup)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	si, err := m.backend.TryPath(snapsup.Name, snapsup.SnapPath, snapsup.Flags, &progress.NullProgress{})
+	if err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	var snapst SnapState
+	if err := Get(t.State(), snapsup.Name, &snapst); err != nil && err != ErrNoState {
+		return err
+	}
+	snapst.Sequence = append(snapst.Sequence, si)
+	snapst.Active = true
+	snapst.TryMode = true
+	Set(t.State(), snapsup.Name, &snapst)
+
+	return nil
+}
+
+func (m *SnapManager) undoTrySnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	var snapsup SnapSetup
+	err := t.Get("snap-setup", &snapsup)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	return m.backend.UndoTryPath(snapsup.Name, &progress.NullProgress{})
+}
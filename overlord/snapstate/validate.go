@@ -0,0 +1,145 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/ubuntu-core/snappy/arch"
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/snap"
+)
+
+// CanInstall checks whether info can be installed given the rest of the
+// snaps already known to st, without touching the backend. It replaces
+// the ad-hoc canInstall precondition checks that used to run inline,
+// before the install/update TaskSet was kicked off, so that they can now
+// run as an observable, cancelable "validate-snap" task instead.
+func CanInstall(st *state.State, info *snap.Info) error {
+	if err := checkArchitecture(info); err != nil {
+		return err
+	}
+	if info.Type == snap.TypeGadget {
+		if err := checkGadgetConflict(st, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkArchitecture(info *snap.Info) error {
+	if len(info.Architectures) == 0 {
+		return nil
+	}
+	want := arch.UbuntuArchitecture()
+	for _, a := range info.Architectures {
+		if a == "all" || a == want {
+			return nil
+		}
+	}
+	return ErrArchitectureNotSupported{Got: info.Architectures[0], Want: []string{want}}
+}
+
+// checkGadgetConflict ensures at most one gadget snap is installed at a
+// time, since the gadget owns exclusive resources like the bootloader
+// configuration.
+func checkGadgetConflict(st *state.State, info *snap.Info) error {
+	all, err := All(st)
+	if err != nil && err != ErrNoState {
+		return err
+	}
+	for name, snapst := range all {
+		if name == info.Name() || snapst.SnapType != string(snap.TypeGadget) {
+			continue
+		}
+		if snapst.Current() != nil {
+			return fmt.Errorf("cannot install gadget snap %q: gadget snap %q already installed", info.Name(), name)
+		}
+	}
+	return nil
+}
+
+// needsLicenseAgreement is the task data recorded on a validate-snap task
+// that is on Hold waiting for a client to accept a snap's license.
+type needsLicenseAgreement struct {
+	Intro   string `json:"intro"`
+	License string `json:"license"`
+}
+
+func (m *SnapManager) doValidateSnap(t *state.Task, _ *tomb.Tomb) error {
+	t.State().Lock()
+	var snapsup SnapSetup
+	err := t.Get("snap-setup", &snapsup)
+	t.State().Unlock()
+	if err != nil {
+		return err
+	}
+
+	info, err := m.backend.SnapInfo(snapsup.Name, snapsup.Channel)
+	if err != nil {
+		return err
+	}
+
+	t.State().Lock()
+	defer t.State().Unlock()
+
+	if err := CanInstall(t.State(), info); err != nil {
+		return logTaskError(t, err)
+	}
+
+	snapsup.SnapType = string(info.Type)
+	t.Set("snap-setup", &snapsup)
+
+	if info.LicenseAgreement != "" {
+		var accepted bool
+		_ = t.Get("license-accepted", &accepted)
+		if !accepted {
+			t.Set("needs-license-agreement", &needsLicenseAgreement{
+				Intro:   fmt.Sprintf("%s requires that you accept the following license before continuing", snapsup.Name),
+				License: info.LicenseAgreement,
+			})
+			t.SetStatus(state.HoldStatus)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// AcceptLicense records that the license for the snap validated by task
+// taskID has been accepted and moves the task back to the normal task
+// runner queue. It is meant to be called from the daemon REST layer when
+// a client PATCHes the task with {"accepted": true}.
+func AcceptLicense(st *state.State, taskID string) error {
+	t := st.Task(taskID)
+	if t == nil {
+		return fmt.Errorf("cannot find task %q", taskID)
+	}
+	if t.Status() != state.HoldStatus {
+		return fmt.Errorf("task %q is not waiting for a license agreement", taskID)
+	}
+
+	t.Set("license-accepted", true)
+	t.SetStatus(state.DoStatus)
+
+	return nil
+}
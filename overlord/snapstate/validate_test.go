@@ -0,0 +1,91 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2016 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"testing"
+
+	"github.com/ubuntu-core/snappy/overlord/state"
+	"github.com/ubuntu-core/snappy/snap"
+)
+
+func TestValidateSnapHoldsForLicenseAgreement(t *testing.T) {
+	st := state.New(nil)
+	m := &SnapManager{backend: &fakeBackend{
+		snapInfo: &snap.Info{LicenseAgreement: "some license text"},
+	}}
+
+	st.Lock()
+	task := st.NewTask("validate-snap", "Validate snap")
+	task.Set("snap-setup", &SnapSetup{Name: "foo", Channel: "stable"})
+	st.Unlock()
+
+	if err := m.doValidateSnap(task, nil); err != nil {
+		t.Fatalf("doValidateSnap failed: %v", err)
+	}
+
+	st.Lock()
+	status := task.Status()
+	var needsLicense needsLicenseAgreement
+	getErr := task.Get("needs-license-agreement", &needsLicense)
+	st.Unlock()
+
+	if status != state.HoldStatus {
+		t.Fatalf("expected task to be on hold, got %v", status)
+	}
+	if getErr != nil || needsLicense.License != "some license text" {
+		t.Fatalf("license agreement was not recorded on the task: err=%v data=%#v", getErr, needsLicense)
+	}
+
+	if err := AcceptLicense(st, task.ID()); err != nil {
+		t.Fatalf("AcceptLicense failed: %v", err)
+	}
+
+	st.Lock()
+	status = task.Status()
+	st.Unlock()
+	if status != state.DoStatus {
+		t.Fatalf("expected task to be requeued after accepting the license, got %v", status)
+	}
+
+	// re-running validate-snap now that the license has been accepted
+	// must not put the task back on hold.
+	if err := m.doValidateSnap(task, nil); err != nil {
+		t.Fatalf("doValidateSnap (after acceptance) failed: %v", err)
+	}
+	st.Lock()
+	status = task.Status()
+	st.Unlock()
+	if status != state.DoStatus {
+		t.Fatalf("validate-snap re-held the task after the license was accepted: %v", status)
+	}
+}
+
+func TestAcceptLicenseRequiresHold(t *testing.T) {
+	st := state.New(nil)
+
+	st.Lock()
+	task := st.NewTask("validate-snap", "Validate snap")
+	st.Unlock()
+
+	if err := AcceptLicense(st, task.ID()); err == nil {
+		t.Fatalf("expected AcceptLicense to fail for a task that isn't on hold")
+	}
+}